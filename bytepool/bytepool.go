@@ -0,0 +1,72 @@
+// Package bytepool hands out power-of-two sized []byte buffers backed by
+// a small set of size-classed sync.Pools, the same strategy Ebiten's
+// texture atlas uses to keep large, short-lived scratch buffers from
+// becoming fresh garbage on every frame. A caller that knows it's done
+// with a buffer calls Release so the next same-sized Get can reuse it;
+// anyone who forgets just lets the GC reclaim it as it would anyway.
+package bytepool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// numClasses covers buffer sizes up to 1<<63, far beyond anything a
+// single image's pixel buffer needs.
+const numClasses = 64
+
+// Pool hands out byte slices sized to the next power of two, pooled per
+// size class so repeated Get/Release cycles of similarly sized buffers
+// don't churn the allocator.
+type Pool struct {
+	classes [numClasses]sync.Pool
+}
+
+// New returns an empty Pool ready to use.
+func New() *Pool {
+	return &Pool{}
+}
+
+// Get returns a []byte of length n, reusing a pooled buffer from n's
+// size class when one is available. A fresh buffer's backing array is
+// sized to the next power of two, but the returned slice is always
+// truncated to exactly n. A reused buffer is zeroed before it's handed
+// back, so callers that rely on "starts empty" (as the image scrambler's
+// shuffle destination does) see the same state a fresh make() would give
+// them, not a previous tenant's bytes.
+func (p *Pool) Get(n int) []byte {
+	class := classFor(n)
+	if v := p.classes[class].Get(); v != nil {
+		buf := v.([]byte)
+		clear(buf)
+		return buf[:n]
+	}
+	return make([]byte, 1<<class)[:n]
+}
+
+// Release returns buf to the pool for reuse by a future Get in the same
+// size class, keyed off buf's capacity rather than its length. The
+// caller must not touch buf again after releasing it.
+func (p *Pool) Release(buf []byte) {
+	class := classFor(cap(buf))
+	p.classes[class].Put(buf[:cap(buf)])
+}
+
+// classFor returns the size-class index (log2 of the bucket's capacity)
+// that fits n bytes.
+func classFor(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return bits.Len(uint(n - 1))
+}
+
+// Default is the pool package-level Get and Release draw from. Most
+// callers don't need a Pool of their own.
+var Default = New()
+
+// Get is a convenience wrapper around Default.Get.
+func Get(n int) []byte { return Default.Get(n) }
+
+// Release is a convenience wrapper around Default.Release.
+func Release(buf []byte) { Default.Release(buf) }
@@ -0,0 +1,20 @@
+package bytepool
+
+import "testing"
+
+func TestGetZeroesReusedBuffer(t *testing.T) {
+	pool := New()
+
+	buf := pool.Get(16)
+	for i := range buf {
+		buf[i] = 0xFF
+	}
+	pool.Release(buf)
+
+	reused := pool.Get(16)
+	for i, b := range reused {
+		if b != 0 {
+			t.Fatalf("reused[%d] = 0x%02x, want 0x00 (previous tenant's bytes leaked through)", i, b)
+		}
+	}
+}
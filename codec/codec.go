@@ -0,0 +1,191 @@
+// Package codec auto-detects JPEG/PNG/GIF/WebP image data, decodes
+// JPEG, PNG and GIF into RGBA while applying any EXIF orientation found
+// in JPEG metadata (WebP is recognized, but Decode returns an error for
+// it), and saves RGBA back out in whichever format the destination path's
+// extension asks for. JPEG output carries a normalized orientation=1
+// EXIF tag plus the original ICC profile (if any), so a decode/encode
+// round trip never silently re-introduces the rotation it just
+// corrected.
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format identifies a sniffed image container.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatJPEG
+	FormatPNG
+	FormatGIF
+	FormatWebP
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJPEG:
+		return "jpeg"
+	case FormatPNG:
+		return "png"
+	case FormatGIF:
+		return "gif"
+	case FormatWebP:
+		return "webp"
+	default:
+		return "unknown"
+	}
+}
+
+// sniff identifies a format from its magic bytes, the same way file(1)
+// or net/http.DetectContentType would, without trusting a file
+// extension.
+func sniff(data []byte) Format {
+	switch {
+	case len(data) >= 2 && data[0] == 0xFF && data[1] == 0xD8:
+		return FormatJPEG
+	case len(data) >= 8 && bytes.Equal(data[:8], []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}):
+		return FormatPNG
+	case len(data) >= 6 && (bytes.Equal(data[:6], []byte("GIF87a")) || bytes.Equal(data[:6], []byte("GIF89a"))):
+		return FormatGIF
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return FormatWebP
+	default:
+		return FormatUnknown
+	}
+}
+
+// Metadata describes what Decode found in the source image beyond its
+// pixels: the container format, the EXIF orientation it corrected for,
+// and the ICC profile to preserve on the next Save.
+type Metadata struct {
+	Format      Format
+	Orientation int // original EXIF orientation, 1 (normal) if none was present
+	ICCProfile  []byte
+}
+
+// Decode auto-detects the format of r, decodes it into RGBA, and
+// rotates/flips the result so it displays upright regardless of the
+// EXIF orientation tag the source JPEG carried. The returned Metadata
+// lets Save restore the ICC profile on the way back out.
+func Decode(r io.Reader) (*image.RGBA, *Metadata, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("codec: reading image data: %w", err)
+	}
+
+	format := sniff(data)
+	meta := &Metadata{Format: format, Orientation: 1}
+
+	var decoded image.Image
+	switch format {
+	case FormatJPEG:
+		decoded, err = jpeg.Decode(bytes.NewReader(data))
+		if err == nil {
+			meta.Orientation, meta.ICCProfile = readJPEGMetadata(data)
+		}
+	case FormatPNG:
+		decoded, err = png.Decode(bytes.NewReader(data))
+	case FormatGIF:
+		decoded, err = gif.Decode(bytes.NewReader(data))
+	case FormatWebP:
+		return nil, nil, fmt.Errorf("codec: WebP decoding needs golang.org/x/image/webp, which this module does not vendor")
+	default:
+		return nil, nil, fmt.Errorf("codec: unrecognized image format")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("codec: decoding %s: %w", format, err)
+	}
+
+	rgba := toRGBA(decoded)
+	rgba = applyOrientation(rgba, meta.Orientation)
+	return rgba, meta, nil
+}
+
+// toRGBA converts any decoded image.Image into a freshly allocated RGBA,
+// pixel by pixel, the same conversion the shuffle pipeline already did
+// inline.
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return rgba
+}
+
+// SaveOptions controls how Save encodes its output. Quality is only
+// consulted for JPEG destinations; ICCProfile, when set, is embedded in
+// JPEG output (pass Metadata.ICCProfile from Decode to round-trip it).
+type SaveOptions struct {
+	Quality    int
+	ICCProfile []byte
+}
+
+// Save picks an encoder from path's extension (.jpg/.jpeg, .png, .gif)
+// and writes img to it. For JPEG it also writes a normalized
+// orientation=1 EXIF block and, if opts.ICCProfile is set, the original
+// ICC profile, so repeated shuffle/restore cycles don't compound
+// rotation or color-profile loss.
+func Save(img image.Image, path string, opts *SaveOptions) error {
+	if opts == nil {
+		opts = &SaveOptions{Quality: 90}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("codec: creating %s: %w", path, err)
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".jpg", ".jpeg":
+		return saveJPEG(f, img, opts.Quality, opts.ICCProfile)
+	case ".png":
+		return png.Encode(f, img)
+	case ".gif":
+		return gif.Encode(f, img, nil)
+	default:
+		return fmt.Errorf("codec: unsupported output extension %q", ext)
+	}
+}
+
+// saveJPEG encodes img normally via image/jpeg, then splices a
+// normalized EXIF orientation segment (and an ICC profile segment, if
+// provided) in right after the SOI marker.
+func saveJPEG(w io.Writer, img image.Image, quality int, icc []byte) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return fmt.Errorf("codec: encoding jpeg: %w", err)
+	}
+	data := buf.Bytes()
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return fmt.Errorf("codec: jpeg encoder did not produce a valid SOI marker")
+	}
+
+	if _, err := w.Write(data[:2]); err != nil {
+		return err
+	}
+	if err := writeAPP1Orientation(w); err != nil {
+		return err
+	}
+	if len(icc) > 0 {
+		if err := writeICCProfile(w, icc); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(data[2:])
+	return err
+}
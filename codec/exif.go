@@ -0,0 +1,153 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// orientationTag is the EXIF IFD0 tag that carries a JPEG's rotate/flip
+// instruction, values 1-8 per the EXIF 2.3 spec.
+const orientationTag = 0x0112
+
+// readJPEGMetadata walks a JPEG's marker segments looking for the EXIF
+// orientation tag (APP1) and an embedded ICC profile (APP2), without
+// needing a full EXIF/ICC parser.
+func readJPEGMetadata(data []byte) (orientation int, icc []byte) {
+	orientation = 1
+
+	i := 2 // skip the SOI marker already confirmed by the caller
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+
+		// Markers with no payload: skip just the 2 marker bytes.
+		if marker == 0xD8 || marker == 0xD9 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA { // start of scan: headers are over
+			break
+		}
+
+		length := int(data[i+2])<<8 | int(data[i+3])
+		segStart, segEnd := i+4, i+2+length
+		if length < 2 || segEnd > len(data) {
+			break
+		}
+		seg := data[segStart:segEnd]
+
+		switch marker {
+		case 0xE1: // APP1
+			if bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+				orientation = parseExifOrientation(seg[6:])
+			}
+		case 0xE2: // APP2
+			if bytes.HasPrefix(seg, []byte("ICC_PROFILE\x00")) && len(seg) > 14 && seg[13] == 1 {
+				// seg = "ICC_PROFILE\x00" + chunk seq (1) + chunk count (1) + data.
+				// Multi-chunk ICC profiles are rare enough in practice
+				// that only the single-chunk case is preserved here.
+				icc = append([]byte(nil), seg[14:]...)
+			}
+		}
+
+		i = segEnd
+	}
+
+	return orientation, icc
+}
+
+// parseExifOrientation reads the orientation value out of a TIFF-format
+// EXIF block (the bytes right after the "Exif\x00\x00" header).
+func parseExifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifdOffset := order.Uint32(tiff[4:8])
+	if int(ifdOffset)+2 > len(tiff) {
+		return 1
+	}
+
+	numEntries := int(order.Uint16(tiff[ifdOffset : ifdOffset+2]))
+	entries := tiff[int(ifdOffset)+2:]
+	for e := 0; e < numEntries; e++ {
+		off := e * 12
+		if off+12 > len(entries) {
+			break
+		}
+		entry := entries[off : off+12]
+		if order.Uint16(entry[0:2]) != orientationTag {
+			continue
+		}
+		if value := int(order.Uint16(entry[8:10])); value >= 1 && value <= 8 {
+			return value
+		}
+	}
+
+	return 1
+}
+
+// writeAPP1Orientation writes an APP1 EXIF segment declaring
+// orientation=1 (normal), so JPEG output never carries a rotation the
+// pixels have already been corrected for.
+func writeAPP1Orientation(w io.Writer) error {
+	tiff := make([]byte, 0, 26)
+	tiff = append(tiff, 'I', 'I')
+	tiff = binary.LittleEndian.AppendUint16(tiff, 42)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8) // IFD0 starts right after this header
+
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:2], orientationTag)
+	binary.LittleEndian.PutUint16(entry[2:4], 3)  // type SHORT
+	binary.LittleEndian.PutUint32(entry[4:8], 1)  // count
+	binary.LittleEndian.PutUint16(entry[8:10], 1) // orientation = normal
+
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1) // one IFD0 entry
+	tiff = append(tiff, entry...)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0) // no next IFD
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	return writeAPPSegment(w, 0xE1, seg)
+}
+
+// writeICCProfile writes profile as a single-chunk APP2 ICC_PROFILE
+// segment. JPEG APP segments are capped at 65533 bytes of payload;
+// profiles larger than that would need chunking, which isn't
+// implemented here.
+func writeICCProfile(w io.Writer, profile []byte) error {
+	const maxPayload = 65533 - len("ICC_PROFILE\x00") - 2
+	if len(profile) > maxPayload {
+		return fmt.Errorf("codec: ICC profile of %d bytes exceeds the %d-byte single-chunk limit", len(profile), maxPayload)
+	}
+
+	seg := append([]byte("ICC_PROFILE\x00"), 1, 1) // chunk 1 of 1
+	seg = append(seg, profile...)
+	return writeAPPSegment(w, 0xE2, seg)
+}
+
+func writeAPPSegment(w io.Writer, marker byte, seg []byte) error {
+	length := len(seg) + 2
+	if length > 0xFFFF {
+		return fmt.Errorf("codec: APP segment of %d bytes exceeds the JPEG 64KB segment limit", length)
+	}
+	header := []byte{0xFF, marker, byte(length >> 8), byte(length)}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(seg)
+	return err
+}
@@ -0,0 +1,82 @@
+package codec
+
+import "image"
+
+// applyOrientation rotates/flips img so it displays upright, undoing
+// whichever of the 8 EXIF orientation values the source declared.
+// Orientation 1 (or anything outside 1-8) means no correction is needed.
+func applyOrientation(img *image.RGBA, orientation int) *image.RGBA {
+	switch orientation {
+	case 2:
+		return flipH(img)
+	case 3:
+		return rotate180(img)
+	case 4:
+		return flipV(img)
+	case 5:
+		return rotate90CCW(flipH(img))
+	case 6:
+		return rotate90CW(img)
+	case 7:
+		return rotate90CW(flipH(img))
+	case 8:
+		return rotate90CCW(img)
+	default:
+		return img
+	}
+}
+
+func flipH(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			srcX := bounds.Max.X - 1 - (x - bounds.Min.X)
+			out.Set(x, y, img.At(srcX, y))
+		}
+	}
+	return out
+}
+
+func flipV(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		srcY := bounds.Max.Y - 1 - (y - bounds.Min.Y)
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			out.Set(x, y, img.At(x, srcY))
+		}
+	}
+	return out
+}
+
+func rotate180(img *image.RGBA) *image.RGBA {
+	return flipV(flipH(img))
+}
+
+// rotate90CW rotates img 90 degrees clockwise, swapping width and height.
+func rotate90CW(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, h, w))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(h-1-y, x, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// rotate90CCW rotates img 90 degrees counter-clockwise, swapping width
+// and height.
+func rotate90CCW(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, h, w))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(y, w-1-x, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
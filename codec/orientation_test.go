@@ -0,0 +1,65 @@
+package codec
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// newMarkedImage builds a w x h RGBA image where every pixel encodes its
+// own (x, y) coordinates, so flips and rotations are distinguishable.
+func newMarkedImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+	return img
+}
+
+func imagesEqual(a, b *image.RGBA) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a.At(x, y) != b.At(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// TestApplyOrientationTable pins each EXIF orientation value to the
+// transform it's defined to produce, built from the independently
+// testable flip/rotate primitives rather than applyOrientation's own
+// switch — so a future slip in the dispatch table (orientations 5 and 7
+// were once swapped) fails here instead of only surfacing as a mangled
+// portrait photo.
+func TestApplyOrientationTable(t *testing.T) {
+	src := newMarkedImage(2, 3)
+
+	cases := []struct {
+		orientation int
+		want        *image.RGBA
+	}{
+		{1, src},
+		{2, flipH(src)},
+		{3, rotate180(src)},
+		{4, flipV(src)},
+		{5, rotate90CCW(flipH(src))},
+		{6, rotate90CW(src)},
+		{7, rotate90CW(flipH(src))},
+		{8, rotate90CCW(src)},
+	}
+
+	for _, c := range cases {
+		got := applyOrientation(src, c.orientation)
+		if !imagesEqual(got, c.want) {
+			t.Errorf("orientation %d: got bounds %v, want bounds %v with mismatched pixels", c.orientation, got.Bounds(), c.want.Bounds())
+		}
+	}
+}
@@ -1,51 +1,37 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"image"
-	"image/jpeg"
 	"os"
 	"path/filepath"
-	"math/rand"
 	"time"
+
+	"github.com/ursa-mikail/mem_remap/bytepool"
+	"github.com/ursa-mikail/mem_remap/codec"
+	"github.com/ursa-mikail/mem_remap/memtrack"
+	"github.com/ursa-mikail/mem_remap/permute"
 )
 
-// offsetMemoryAddressing tracks byte changes at specific memory offsets
-type offsetMemoryAddressing struct {
-	offsets map[int64]byte
+// newPooledRGBA allocates an RGBA image the same shape image.NewRGBA
+// would, except its Pix slice is drawn from bytepool instead of a fresh
+// make(); for a 4K frame that's ~32 MB handed back for reuse instead of
+// left for the GC every shuffle/restore cycle.
+func newPooledRGBA(bounds image.Rectangle) *image.RGBA {
+	stride := bounds.Dx() * 4
+	pix := bytepool.Get(stride * bounds.Dy())
+	return &image.RGBA{Pix: pix, Stride: stride, Rect: bounds}
 }
 
-func (o *offsetMemoryAddressing) removeMemoryAddress(mem []byte) error {
-	if len(mem) == 0 {
-		return fmt.Errorf("mem block is empty")
-	}
-
-	for offset, originalByte := range o.offsets {
-		if offset < 0 || offset >= int64(len(mem)) {
-			return fmt.Errorf("offset %d is out of bounds", offset)
-		}
-		mem[offset] = originalByte
-	}
-
-	o.offsets = make(map[int64]byte)
-	return nil
-}
-
-// Helper method to modify bytes and track changes
-func (o *offsetMemoryAddressing) modifyBytes(mem []byte, offset int64, newValue byte) error {
-	if offset < 0 || offset >= int64(len(mem)) {
-		return fmt.Errorf("offset %d is out of bounds", offset)
-	}
-	
-	// Store original byte if not already tracked
-	if _, exists := o.offsets[offset]; !exists {
-		o.offsets[offset] = mem[offset]
-	}
-	
-	// Apply modification
-	mem[offset] = newValue
-	return nil
-}
+// streamThresholdBytes is the pixel-buffer size above which the shuffle
+// pipeline switches from the in-memory Fisher-Yates path to stream's
+// mmap-backed tiled engine (see runStreamingShuffle), so a buffer that
+// would otherwise need two full in-memory copies (source and scrambled)
+// never has to fit in RAM at once. It's declared here rather than in
+// stream_pipeline.go so the non-unix build (which never streams) and
+// maxTrackedUndoRecords below can both see the same number.
+const streamThresholdBytes = 64 * 1024 * 1024 // 64 MiB, roughly two 4K RGBA frames
 
 func main() {
 	// Load sample image from /images directory
@@ -58,65 +44,80 @@ func main() {
 	}
 	defer file.Close()
 
-	img, err := jpeg.Decode(file)
+	// codec.Decode sniffs the actual format instead of assuming JPEG, and
+	// corrects for any EXIF orientation so a portrait phone photo isn't
+	// mangled before the shuffle ever touches it.
+	originalImg, meta, err := codec.Decode(file)
 	if err != nil {
 		fmt.Printf("Error decoding image: %v\n", err)
 		return
 	}
 
-	bounds := img.Bounds()
+	bounds := originalImg.Bounds()
 	width, height := bounds.Dx(), bounds.Dy()
 	totalPixels := width * height
-	
-	fmt.Printf("Original image: %dx%d pixels, %d total pixels\n", width, height, totalPixels)
-	
-	// Convert image to RGBA for easier pixel manipulation
-	originalImg := image.NewRGBA(bounds)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			originalImg.Set(x, y, img.At(x, y))
-		}
-	}
 
-	// Create a permutation (shuffle) of all pixel indices
-	rand.Seed(time.Now().UnixNano())
-	shuffledIndices := make([]int, totalPixels)
-	for i := 0; i < totalPixels; i++ {
-		shuffledIndices[i] = i
-	}
-	
-	// Shuffle the indices using Fisher-Yates algorithm
-	for i := totalPixels - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
-		shuffledIndices[i], shuffledIndices[j] = shuffledIndices[j], shuffledIndices[i]
-	}
+	fmt.Printf("Original image: %dx%d pixels, %d total pixels (format: %s, orientation: %d)\n",
+		width, height, totalPixels, meta.Format, meta.Orientation)
 
-	fmt.Printf("Created shuffled indices for %d pixels\n", len(shuffledIndices))
+	// Create a reversible permutation of all pixel indices using the
+	// same Fisher-Yates strategy the shuffle used to do inline; perm
+	// computes both directions on demand, so there's no separate
+	// reverseShuffle slice to keep in sync.
+	perm := permute.NewFisherYates(time.Now().UnixNano(), totalPixels)
+
+	fmt.Printf("Created shuffle permutation for %d pixels\n", perm.Len())
 
 	// Show some shuffle examples
 	fmt.Println("\nShuffle examples:")
 	for i := 0; i < 5; i++ {
 		origX, origY := i%width, i/width
-		shuffledIdx := shuffledIndices[i]
+		shuffledIdx := perm.At(i)
 		shuffledX, shuffledY := shuffledIdx%width, shuffledIdx/width
-		
+
 		// Get original pixel values
 		origR, origG, origB, _ := originalImg.At(origX, origY).RGBA()
-		fmt.Printf("  Pixel at (%d,%d) [R:%d G:%d B:%d] -> moves to (%d,%d)\n", 
+		fmt.Printf("  Pixel at (%d,%d) [R:%d G:%d B:%d] -> moves to (%d,%d)\n",
 			origX, origY, origR>>8, origG>>8, origB>>8, shuffledX, shuffledY)
 	}
 
-	// Create scrambled image - start with empty image
-	scrambledImg := image.NewRGBA(bounds)
-	tracker := &offsetMemoryAddressing{
-		offsets: make(map[int64]byte),
+	// Above streamThresholdBytes, hand the shuffle to stream's mmap-backed
+	// tiled engine instead of building a second full-frame copy in
+	// memory; below it (as for this package's small sample.jpg), the
+	// in-memory Fisher-Yates path below is simpler and plenty fast.
+	scrambledPath := filepath.Join("images", "scrambled.png")
+	if handled, err := runStreamingShuffle(imagePath, scrambledPath, len(originalImg.Pix)); err != nil {
+		fmt.Printf("Error during streaming shuffle: %v\n", err)
+		return
+	} else if handled {
+		fmt.Printf("Saved shuffled image as: %s\n", scrambledPath)
+		return
 	}
 
+	// Create scrambled image - start with empty image, Pix drawn from
+	// the shared bytepool rather than a fresh allocation
+	scrambledImg := newPooledRGBA(bounds)
+	defer bytepool.Release(scrambledImg.Pix)
+
+	// maxTrackedUndoRecords bounds the tracker's undo depth so that even
+	// an image well above streamThresholdBytes processed this way (e.g.
+	// on a non-unix platform, where the streaming engine above is
+	// unavailable) keeps tracking overhead bounded instead of growing
+	// one list/map entry per tracked byte forever. It's set to
+	// streamThresholdBytes itself: on unix, any image routed through this
+	// in-memory path is under that many bytes, so the bound never evicts
+	// mid-shuffle there; on other platforms a larger image does evict its
+	// oldest records.
+	const maxTrackedUndoRecords = streamThresholdBytes
+	tracker := memtrack.NewBounded(maxTrackedUndoRecords)
+
 	fmt.Println("\nApplying pixel shuffle...")
 	bytesPerPixel := 4 // RGBA
 
 	// Apply the shuffle: copy each pixel from original position to shuffled position
-	for originalIdx, shuffledIdx := range shuffledIndices {
+	for originalIdx := 0; originalIdx < totalPixels; originalIdx++ {
+		shuffledIdx := perm.At(originalIdx)
+
 		// Calculate coordinates
 		origX := originalIdx % width
 		origY := originalIdx / width
@@ -125,75 +126,72 @@ func main() {
 
 		// Get the pixel value from ORIGINAL image
 		r, g, b, a := originalImg.At(origX, origY).RGBA()
-		
+
 		// Calculate byte offsets in scrambled image
 		scrambledOffset := (shuffledY*width + shuffledX) * bytesPerPixel
-		
+
 		// Store the ORIGINAL pixel value at the NEW position
 		// Since scrambledImg starts empty, we're setting pixels for the first time
-		tracker.modifyBytes(scrambledImg.Pix, int64(scrambledOffset), byte(r>>8))
-		tracker.modifyBytes(scrambledImg.Pix, int64(scrambledOffset+1), byte(g>>8))
-		tracker.modifyBytes(scrambledImg.Pix, int64(scrambledOffset+2), byte(b>>8))
-		tracker.modifyBytes(scrambledImg.Pix, int64(scrambledOffset+3), byte(a>>8))
+		tracker.ModifyBytes(scrambledImg.Pix, int64(scrambledOffset), byte(r>>8))
+		tracker.ModifyBytes(scrambledImg.Pix, int64(scrambledOffset+1), byte(g>>8))
+		tracker.ModifyBytes(scrambledImg.Pix, int64(scrambledOffset+2), byte(b>>8))
+		tracker.ModifyBytes(scrambledImg.Pix, int64(scrambledOffset+3), byte(a>>8))
 	}
 
-	fmt.Printf("Tracked %d byte modifications during shuffling\n", len(tracker.offsets))
+	fmt.Printf("Tracked %d byte modifications during shuffling\n", tracker.Cardinality())
 
-	// Save scrambled image
-	scrambledPath := filepath.Join("images", "scrambled.jpg")
-	scrambledFile, err := os.Create(scrambledPath)
-	if err != nil {
-		fmt.Printf("Error creating scrambled image: %v\n", err)
+	// Save scrambled image as PNG: shuffling already scatters every
+	// pixel, so there's no reason to add JPEG requantization on top of
+	// that and risk the restoration check below finding near-misses
+	// instead of exact matches.
+	if err := codec.Save(scrambledImg, scrambledPath, nil); err != nil {
+		fmt.Printf("Error saving scrambled image: %v\n", err)
 		return
 	}
-	defer scrambledFile.Close()
-	
-	jpeg.Encode(scrambledFile, scrambledImg, &jpeg.Options{Quality: 90})
 	fmt.Printf("Saved shuffled image as: %s\n", scrambledPath)
 
 	// Verify that pixel VALUES are preserved in shuffled image
 	fmt.Println("\nVerifying pixel values after shuffling:")
 	for i := 0; i < 3; i++ {
 		origX, origY := i%width, i/width
-		shuffledIdx := shuffledIndices[i]
+		shuffledIdx := perm.At(i)
 		shuffledX, shuffledY := shuffledIdx%width, shuffledIdx/width
-		
+
 		// Get original pixel value
 		origR, origG, origB, _ := originalImg.At(origX, origY).RGBA()
 		// Get the value at the shuffled position in scrambled image
 		shuffledR, shuffledG, shuffledB, _ := scrambledImg.At(shuffledX, shuffledY).RGBA()
-		
+
 		valuesMatch := origR == shuffledR && origG == shuffledG && origB == shuffledB
-		fmt.Printf("  Pixel from (%d,%d) [R:%d] moved to (%d,%d) [R:%d] - Values match: %t\n", 
+		fmt.Printf("  Pixel from (%d,%d) [R:%d] moved to (%d,%d) [R:%d] - Values match: %t\n",
 			origX, origY, origR>>8, shuffledX, shuffledY, shuffledR>>8, valuesMatch)
 	}
 
-	// Now restore using removeMemoryAddress
-	fmt.Println("\nRestoring using removeMemoryAddress...")
-	
+	// Now restore using RemoveMemoryAddress
+	fmt.Println("\nRestoring using RemoveMemoryAddress...")
+
 	// Create a copy of scrambled image for restoration
-	scrambledCopy := image.NewRGBA(bounds)
+	scrambledCopy := newPooledRGBA(bounds)
+	defer bytepool.Release(scrambledCopy.Pix)
 	copy(scrambledCopy.Pix, scrambledImg.Pix)
-	
+
 	// This should restore the scrambled image to its original empty state
 	// But wait - this won't work because we want to restore the ORIGINAL image, not empty!
 	// Let's think differently...
-	
-	// Instead, let's create a new image and use the reverse mapping
-	fmt.Println("\nCreating reverse shuffle mapping...")
-	reverseShuffle := make([]int, totalPixels)
-	for originalIdx, shuffledIdx := range shuffledIndices {
-		reverseShuffle[shuffledIdx] = originalIdx
-	}
+
+	// Instead, let's create a new image and walk the permutation
+	// backwards via perm.Invert, which needs no reverseShuffle slice
+	fmt.Println("\nCreating restored image from the permutation's inverse...")
 
 	// Create restored image by applying reverse shuffle
-	restoredImg := image.NewRGBA(bounds)
-	tracker2 := &offsetMemoryAddressing{
-		offsets: make(map[int64]byte),
-	}
+	restoredImg := newPooledRGBA(bounds)
+	defer bytepool.Release(restoredImg.Pix)
+	tracker2 := memtrack.New()
 
 	fmt.Println("Applying reverse shuffle...")
-	for shuffledIdx, originalIdx := range reverseShuffle {
+	for shuffledIdx := 0; shuffledIdx < totalPixels; shuffledIdx++ {
+		originalIdx := perm.Invert(shuffledIdx)
+
 		// Calculate coordinates
 		shuffledX := shuffledIdx % width
 		shuffledY := shuffledIdx / width
@@ -202,27 +200,25 @@ func main() {
 
 		// Get pixel from scrambled image
 		r, g, b, a := scrambledImg.At(shuffledX, shuffledY).RGBA()
-		
+
 		// Calculate byte offsets in restored image
 		restoredOffset := (origY*width + origX) * bytesPerPixel
-		
+
 		// Store pixel back at original position
-		tracker2.modifyBytes(restoredImg.Pix, int64(restoredOffset), byte(r>>8))
-		tracker2.modifyBytes(restoredImg.Pix, int64(restoredOffset+1), byte(g>>8))
-		tracker2.modifyBytes(restoredImg.Pix, int64(restoredOffset+2), byte(b>>8))
-		tracker2.modifyBytes(restoredImg.Pix, int64(restoredOffset+3), byte(a>>8))
+		tracker2.ModifyBytes(restoredImg.Pix, int64(restoredOffset), byte(r>>8))
+		tracker2.ModifyBytes(restoredImg.Pix, int64(restoredOffset+1), byte(g>>8))
+		tracker2.ModifyBytes(restoredImg.Pix, int64(restoredOffset+2), byte(b>>8))
+		tracker2.ModifyBytes(restoredImg.Pix, int64(restoredOffset+3), byte(a>>8))
 	}
 
-	// Save restored image
-	restoredPath := filepath.Join("images", "restored.jpg")
-	restoredFile, err := os.Create(restoredPath)
-	if err != nil {
-		fmt.Printf("Error creating restored image: %v\n", err)
+	// Save restored image as PNG, and carry over the original ICC
+	// profile so a restored JPEG-sourced image wouldn't need one either
+	// way; codec.Save only embeds it for JPEG destinations.
+	restoredPath := filepath.Join("images", "restored.png")
+	if err := codec.Save(restoredImg, restoredPath, &codec.SaveOptions{ICCProfile: meta.ICCProfile}); err != nil {
+		fmt.Printf("Error saving restored image: %v\n", err)
 		return
 	}
-	defer restoredFile.Close()
-	
-	jpeg.Encode(restoredFile, restoredImg, &jpeg.Options{Quality: 90})
 	fmt.Printf("Saved restored image as: %s\n", restoredPath)
 
 	// Verify restoration by comparing with original
@@ -231,30 +227,95 @@ func main() {
 	for i := 0; i < totalPixels && i < 100; i++ {
 		x := i % width
 		y := i / width
-		
+
 		origR, origG, origB, origA := originalImg.At(x, y).RGBA()
 		restoredR, restoredG, restoredB, restoredA := restoredImg.At(x, y).RGBA()
-		
+
 		if origR == restoredR && origG == restoredG && origB == restoredB && origA == restoredA {
 			matches++
 		}
 	}
-	
+
 	fmt.Printf("Pixel matching: %d/100 pixels match original\n", matches)
-	
+
 	if matches == 100 {
 		fmt.Println("✓ Perfect restoration achieved!")
 	} else {
 		fmt.Println("⚠ Some pixels don't match")
 	}
 
-	// Demonstrate removeMemoryAddress on the scrambled image
-	fmt.Println("\n=== Demonstrating removeMemoryAddress on scrambled image ===")
-	err = tracker.removeMemoryAddress(scrambledImg.Pix)
+	// Demonstrate permute.Apply/Invert directly: unlike the tracked loops
+	// above, these need no manual offset math or reverseShuffle slice,
+	// at the cost of not recording which bytes changed.
+	fmt.Println("\n=== Demonstrating permute.Apply/Invert directly ===")
+	viaApply := newPooledRGBA(bounds)
+	defer bytepool.Release(viaApply.Pix)
+	if err := permute.Apply(originalImg, viaApply, perm); err != nil {
+		fmt.Printf("Error during permute.Apply: %v\n", err)
+		return
+	}
+
+	viaInvert := newPooledRGBA(bounds)
+	defer bytepool.Release(viaInvert.Pix)
+	if err := permute.Invert(viaApply, viaInvert, perm); err != nil {
+		fmt.Printf("Error during permute.Invert: %v\n", err)
+		return
+	}
+
+	applyMatches := 0
+	for i := 0; i < totalPixels && i < 100; i++ {
+		x, y := i%width, i/width
+		origR, origG, origB, origA := originalImg.At(x, y).RGBA()
+		gotR, gotG, gotB, gotA := viaInvert.At(x, y).RGBA()
+		if origR == gotR && origG == gotG && origB == gotB && origA == gotA {
+			applyMatches++
+		}
+	}
+	fmt.Printf("permute.Apply/Invert round trip: %d/100 pixels match original\n", applyMatches)
+
+	// Demonstrate RemoveMemoryAddress on the scrambled image
+	fmt.Println("\n=== Demonstrating RemoveMemoryAddress on scrambled image ===")
+	err = tracker.RemoveMemoryAddress(scrambledImg.Pix)
 	if err != nil {
-		fmt.Printf("Error during removeMemoryAddress: %v\n", err)
+		fmt.Printf("Error during RemoveMemoryAddress: %v\n", err)
+		return
+	}
+	fmt.Printf("After RemoveMemoryAddress - scrambled image bytes were reset\n")
+	fmt.Printf("Remaining tracked offsets: %d\n", tracker.Cardinality())
+
+	// Demonstrate the transactional journal: a speculative edit on the
+	// restored image, rolled back, then a second edit that's committed
+	// and checkpointed to a byte stream.
+	fmt.Println("\n=== Demonstrating transactional journal on restored image ===")
+	journalTracker := memtrack.New()
+
+	speculative := journalTracker.BeginTx()
+	journalTracker.ModifyBytesTx(speculative, restoredImg.Pix, 0, 0xAA)
+	fmt.Printf("Speculative edit applied: restoredImg.Pix[0] = 0x%02x\n", restoredImg.Pix[0])
+	if err := journalTracker.Rollback(speculative, restoredImg.Pix); err != nil {
+		fmt.Printf("Error during Rollback: %v\n", err)
+		return
+	}
+	fmt.Printf("After Rollback: restoredImg.Pix[0] = 0x%02x\n", restoredImg.Pix[0])
+
+	committed := journalTracker.BeginTx()
+	journalTracker.ModifyBytesTx(committed, restoredImg.Pix, 0, 0xBB)
+	if err := journalTracker.Commit(committed); err != nil {
+		fmt.Printf("Error during Commit: %v\n", err)
+		return
+	}
+	fmt.Printf("After Commit: restoredImg.Pix[0] = 0x%02x\n", restoredImg.Pix[0])
+
+	var checkpoint bytes.Buffer
+	if err := journalTracker.Checkpoint(&checkpoint); err != nil {
+		fmt.Printf("Error during Checkpoint: %v\n", err)
 		return
 	}
-	fmt.Printf("After removeMemoryAddress - scrambled image bytes were reset\n")
-	fmt.Printf("Remaining tracked offsets: %d\n", len(tracker.offsets))
-}
\ No newline at end of file
+
+	restoredTracker := memtrack.New()
+	if err := restoredTracker.Restore(&checkpoint); err != nil {
+		fmt.Printf("Error during Restore: %v\n", err)
+		return
+	}
+	fmt.Printf("Checkpoint round-trip restored %d journal records\n", restoredTracker.JournalLen())
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ursa-mikail/mem_remap/stream"
+)
+
+// shuffleKey keys the Feistel permutation stream.ShuffleFile uses; it
+// plays the same role time.Now().UnixNano() does for the in-memory
+// Fisher-Yates path below.
+var shuffleKey = []byte("mem_remap-image-scrambler-stream-key")
+
+// runStreamingShuffle shuffles imagePath straight to scrambledPath via
+// stream.ShuffleFile once totalBytes crosses streamThresholdBytes. It
+// reports whether it handled the shuffle; false means the caller should
+// fall back to the in-memory path below.
+func runStreamingShuffle(imagePath, scrambledPath string, totalBytes int) (bool, error) {
+	if totalBytes < streamThresholdBytes {
+		return false, nil
+	}
+	fmt.Printf("Image is %d bytes (>= %d byte threshold); using the mmap-backed streaming engine instead of the in-memory path\n",
+		totalBytes, streamThresholdBytes)
+	if err := stream.ShuffleFile(imagePath, scrambledPath, shuffleKey); err != nil {
+		return true, fmt.Errorf("streaming shuffle: %w", err)
+	}
+	return true, nil
+}
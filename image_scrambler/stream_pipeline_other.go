@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+// runStreamingShuffle never handles the shuffle on non-unix platforms,
+// since stream.ShuffleFile relies on syscall.Mmap. The caller always
+// falls back to the in-memory path.
+func runStreamingShuffle(imagePath, scrambledPath string, totalBytes int) (bool, error) {
+	return false, nil
+}
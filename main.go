@@ -1,86 +1,86 @@
 package main
 
 import (
-    "fmt"
+	"bytes"
+	"fmt"
+
+	"github.com/ursa-mikail/mem_remap/memtrack"
 )
 
-// offsetMemoryAddressing tracks byte changes at specific memory offsets
-type offsetMemoryAddressing struct {
-    offsets map[int64]byte
-}
+func main() {
+	// Example: Temporary patch for debugging or testing
+	data := []byte{0x10, 0x20, 0x30, 0x40, 0x50}
+	fmt.Printf("Original data: % x\n", data)
 
-func (o *offsetMemoryAddressing) removeMemoryAddress(mem []byte) error {
-    if len(mem) == 0 {
-        return fmt.Errorf("mem block is empty")
-    }
+	// Create offset tracker
+	tracker := memtrack.New()
 
-    for offset, originalByte := range o.offsets {
-        if offset < 0 || offset >= int64(len(mem)) {
-            return fmt.Errorf("offset %d is out of bounds", offset)
-        }
-        mem[offset] = originalByte
-    }
+	// Apply temporary modifications
+	tracker.ModifyBytes(data, 1, 0x99) // Change byte at offset 1
+	tracker.ModifyBytes(data, 3, 0x77) // Change byte at offset 3
 
-    o.offsets = make(map[int64]byte)
-    return nil
-}
+	fmt.Printf("After modifications: % x\n", data)
+	tracker.Iterate(func(offset int64, originalByte byte) bool {
+		fmt.Printf("  tracked offset %d -> original byte 0x%02x\n", offset, originalByte)
+		return true
+	})
 
-// Helper method to modify bytes and track changes
-func (o *offsetMemoryAddressing) modifyBytes(mem []byte, offset int64, newValue byte) error {
-    if offset < 0 || offset >= int64(len(mem)) {
-        return fmt.Errorf("offset %d is out of bounds", offset)
-    }
-    
-    // Store original byte if not already tracked
-    if _, exists := o.offsets[offset]; !exists {
-        o.offsets[offset] = mem[offset]
-    }
-    
-    // Apply modification
-    mem[offset] = newValue
-    return nil
-}
+	// Restore original values
+	err := tracker.RemoveMemoryAddress(data)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 
-func main() {
-    // Example: Temporary patch for debugging or testing
-    data := []byte{0x10, 0x20, 0x30, 0x40, 0x50}
-    fmt.Printf("Original data: % x\n", data)
-    
-    // Create offset tracker
-    tracker := &offsetMemoryAddressing{
-        offsets: make(map[int64]byte),
-    }
-    
-    // Apply temporary modifications
-    tracker.modifyBytes(data, 1, 0x99)  // Change byte at offset 1
-    tracker.modifyBytes(data, 3, 0x77)  // Change byte at offset 3
-    
-    fmt.Printf("After modifications: % x\n", data)
-    fmt.Printf("Tracked offsets: %v\n", tracker.offsets)
-    
-    // Restore original values
-    err := tracker.removeMemoryAddress(data)
-    if err != nil {
-        fmt.Printf("Error: %v\n", err)
-        return
-    }
-    
-    fmt.Printf("After restoration: % x\n", data)
-    fmt.Printf("Remaining tracked offsets: %v\n", tracker.offsets)
+	fmt.Printf("After restoration: % x\n", data)
+	fmt.Printf("Remaining tracked containers: %d\n", tracker.ContainerCount())
+
+	// Example: a speculative transaction, rolled back, then a second
+	// transaction that's committed and checkpointed to a byte stream.
+	fmt.Println("\n=== Transactional journal ===")
+	speculative := tracker.BeginTx()
+	tracker.ModifyBytesTx(speculative, data, 0, 0xAA)
+	fmt.Printf("Speculative edit applied: % x\n", data)
+	if err := tracker.Rollback(speculative, data); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("After Rollback: % x\n", data)
+
+	committed := tracker.BeginTx()
+	tracker.ModifyBytesTx(committed, data, 0, 0xBB)
+	if err := tracker.Commit(committed); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("After Commit: % x\n", data)
+
+	var checkpoint bytes.Buffer
+	if err := tracker.Checkpoint(&checkpoint); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	restored := memtrack.New()
+	if err := restored.Restore(&checkpoint); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Checkpoint round-trip restored %d journal records\n", restored.JournalLen())
 }
 
 /*
 Original data: 10 20 30 40 50
 After modifications: 10 99 30 77 50
-Tracked offsets: map[1:32 3:64]
-
-"""
-map[1:32 3:64] means:
-
-Offset 1 maps to byte value 32 (0x20 in hex)
-Offset 3 maps to byte value 64 (0x40 in hex)
-"""
+  tracked offset 1 -> original byte 0x20
+  tracked offset 3 -> original byte 0x40
 
 After restoration: 10 20 30 40 50
-Remaining tracked offsets: map[]
-*/
\ No newline at end of file
+Remaining tracked containers: 0
+
+=== Transactional journal ===
+Speculative edit applied: aa 20 30 40 50
+After Rollback: 10 20 30 40 50
+After Commit: bb 20 30 40 50
+Checkpoint round-trip restored 2 journal records
+*/
@@ -0,0 +1,335 @@
+// Package memtrack tracks byte-level changes to a memory buffer using a
+// roaring-bitmap-style hybrid store, so scrambling or patching an image
+// that's tens to hundreds of megabytes uses megabytes of bookkeeping
+// instead of the gigabytes a flat map[int64]byte would cost. It also
+// layers a transactional journal on top, so speculative edits can be
+// rolled back independently of the tracker's own whole-buffer undo.
+package memtrack
+
+import (
+	"sort"
+
+	"github.com/ursa-mikail/mem_remap/bytepool"
+)
+
+// containerArrayMaxCardinality is the number of dirty offsets a single
+// 16-bit container tolerates in its sparse array form before it is
+// converted to a dense bitmap. This mirrors the roaring bitmap threshold
+// of "array while sparse, bitmap once dense".
+const containerArrayMaxCardinality = 4096
+
+// containerBits is the width of the low part of an offset that a single
+// container addresses; the remaining high bits select the container.
+const containerBits = 16
+const containerSize = 1 << containerBits
+const containerWords = containerSize / 64
+
+// containerRunMinLength is the smallest contiguous run worth collapsing
+// into the run-length representation instead of an array.
+const containerRunMinLength = 32
+
+type containerKind uint8
+
+const (
+	containerArray containerKind = iota
+	containerBitmap
+	containerRun
+)
+
+// run is an inclusive, contiguous span of low-offsets, used by
+// containerRun to represent a large block of consecutive dirty bytes
+// without storing every offset individually.
+type run struct {
+	start  uint16
+	length uint32 // number of offsets covered, starting at start
+}
+
+// offsetContainer is the dirty-offset index for a single 16-bit slice of
+// the 64-bit offset space, plus the original bytes shadowed at those
+// offsets in ascending offset order. It picks whichever of the three
+// roaring-bitmap container forms (array, bitmap, run) is cheapest for
+// its current cardinality.
+type offsetContainer struct {
+	kind   containerKind
+	array  []uint16 // containerArray: sorted low bits present
+	bitmap []uint64 // containerBitmap: containerWords words
+	dense  []byte   // containerBitmap: shadow bytes indexed by low bit
+	runs   []run    // containerRun: sorted, non-overlapping
+	shadow []byte   // containerArray/containerRun: shadow bytes, offset-sorted
+}
+
+func newOffsetContainer() *offsetContainer {
+	return &offsetContainer{kind: containerArray}
+}
+
+// insert records that low is now dirty, shadowing originalByte if low
+// was not already tracked. It returns false if low was already present.
+func (c *offsetContainer) insert(low uint16, originalByte byte) bool {
+	switch c.kind {
+	case containerBitmap:
+		word, bit := low/64, uint(low%64)
+		if c.bitmap[word]&(1<<bit) != 0 {
+			return false
+		}
+		c.bitmap[word] |= 1 << bit
+		c.dense[low] = originalByte
+		return true
+
+	case containerRun:
+		if _, ok := c.runIndex(low); ok {
+			return false
+		}
+		c.array, c.shadow = c.expandRunsToArray()
+		c.kind = containerArray
+		return c.insert(low, originalByte)
+
+	default: // containerArray
+		pos := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+		if pos < len(c.array) && c.array[pos] == low {
+			return false
+		}
+		c.array = append(c.array, 0)
+		copy(c.array[pos+1:], c.array[pos:])
+		c.array[pos] = low
+
+		c.shadow = append(c.shadow, 0)
+		copy(c.shadow[pos+1:], c.shadow[pos:])
+		c.shadow[pos] = originalByte
+
+		if len(c.array) > containerArrayMaxCardinality {
+			c.convertToBitmap()
+		} else {
+			c.tryConvertToRun()
+		}
+		return true
+	}
+}
+
+func (c *offsetContainer) convertToBitmap() {
+	bitmap := make([]uint64, containerWords)
+	// containerSize is exactly 1<<containerBits, so the dense shadow
+	// array is always a perfect fit for bytepool's size classes.
+	dense := bytepool.Get(containerSize)
+	for i, low := range c.array {
+		bitmap[low/64] |= 1 << uint(low%64)
+		dense[low] = c.shadow[i]
+	}
+	c.kind = containerBitmap
+	c.bitmap = bitmap
+	c.dense = dense
+	c.array = nil
+	c.shadow = nil
+}
+
+// tryConvertToRun collapses the array into the run-length form when every
+// tracked offset forms one contiguous block, which is the common case
+// when a caller patches a whole span of bytes (e.g. an image tile).
+func (c *offsetContainer) tryConvertToRun() {
+	if len(c.array) < containerRunMinLength {
+		return
+	}
+	first, last := c.array[0], c.array[len(c.array)-1]
+	if int(last)-int(first)+1 != len(c.array) {
+		return
+	}
+	c.kind = containerRun
+	c.runs = []run{{start: first, length: uint32(len(c.array))}}
+	// shadow is already in ascending offset order, which is exactly the
+	// order a single contiguous run needs.
+	c.array = nil
+}
+
+func (c *offsetContainer) expandRunsToArray() ([]uint16, []byte) {
+	array := make([]uint16, 0, c.cardinality())
+	shadow := make([]byte, 0, c.cardinality())
+	idx := 0
+	for _, r := range c.runs {
+		for i := uint32(0); i < r.length; i++ {
+			array = append(array, r.start+uint16(i))
+			shadow = append(shadow, c.shadow[idx])
+			idx++
+		}
+	}
+	return array, shadow
+}
+
+// runIndex returns the position of low within c.shadow if it falls
+// inside one of c.runs.
+func (c *offsetContainer) runIndex(low uint16) (int, bool) {
+	offset := 0
+	for _, r := range c.runs {
+		if low >= r.start && int(low) < int(r.start)+int(r.length) {
+			return offset + int(low-r.start), true
+		}
+		offset += int(r.length)
+	}
+	return 0, false
+}
+
+// get returns the shadowed original byte for low, if tracked.
+func (c *offsetContainer) get(low uint16) (byte, bool) {
+	switch c.kind {
+	case containerBitmap:
+		word, bit := low/64, uint(low%64)
+		if c.bitmap[word]&(1<<bit) == 0 {
+			return 0, false
+		}
+		return c.dense[low], true
+
+	case containerRun:
+		if idx, ok := c.runIndex(low); ok {
+			return c.shadow[idx], true
+		}
+		return 0, false
+
+	default:
+		pos := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+		if pos < len(c.array) && c.array[pos] == low {
+			return c.shadow[pos], true
+		}
+		return 0, false
+	}
+}
+
+func (c *offsetContainer) cardinality() int {
+	switch c.kind {
+	case containerBitmap:
+		n := 0
+		for _, word := range c.bitmap {
+			n += popcount(word)
+		}
+		return n
+	case containerRun:
+		n := 0
+		for _, r := range c.runs {
+			n += int(r.length)
+		}
+		return n
+	default:
+		return len(c.array)
+	}
+}
+
+// iterate walks every tracked (low, originalByte) pair in ascending
+// offset order, stopping early if fn returns false.
+func (c *offsetContainer) iterate(fn func(low uint16, originalByte byte) bool) {
+	switch c.kind {
+	case containerBitmap:
+		for low := 0; low < containerSize; low++ {
+			word, bit := low/64, uint(low%64)
+			if c.bitmap[word]&(1<<bit) == 0 {
+				continue
+			}
+			if !fn(uint16(low), c.dense[low]) {
+				return
+			}
+		}
+	case containerRun:
+		idx := 0
+		for _, r := range c.runs {
+			for i := uint32(0); i < r.length; i++ {
+				if !fn(r.start+uint16(i), c.shadow[idx]) {
+					return
+				}
+				idx++
+			}
+		}
+	default:
+		for i, low := range c.array {
+			if !fn(low, c.shadow[i]) {
+				return
+			}
+		}
+	}
+}
+
+// remove forgets low, if tracked, so its shadow byte is no longer kept.
+// It backs OffsetMemoryAddressing's bounded undo log: evicting the
+// oldest record just means that one byte can no longer be restored.
+func (c *offsetContainer) remove(low uint16) bool {
+	switch c.kind {
+	case containerBitmap:
+		word, bit := low/64, uint(low%64)
+		if c.bitmap[word]&(1<<bit) == 0 {
+			return false
+		}
+		c.bitmap[word] &^= 1 << bit
+		return true
+
+	case containerRun:
+		for idx := range c.runs {
+			r := c.runs[idx]
+			if low < r.start || int(low) >= int(r.start)+int(r.length) {
+				continue
+			}
+			shadowStart := c.runShadowStart(idx)
+			relative := int(low - r.start)
+			c.shadow = append(c.shadow[:shadowStart+relative], c.shadow[shadowStart+relative+1:]...)
+
+			switch {
+			case r.length == 1:
+				c.runs = append(c.runs[:idx], c.runs[idx+1:]...)
+			case relative == 0:
+				c.runs[idx].start++
+				c.runs[idx].length--
+			case relative == int(r.length)-1:
+				c.runs[idx].length--
+			default:
+				left := run{start: r.start, length: uint32(relative)}
+				right := run{start: low + 1, length: r.length - uint32(relative) - 1}
+				newRuns := make([]run, 0, len(c.runs)+1)
+				newRuns = append(newRuns, c.runs[:idx]...)
+				newRuns = append(newRuns, left, right)
+				newRuns = append(newRuns, c.runs[idx+1:]...)
+				c.runs = newRuns
+			}
+			return true
+		}
+		return false
+
+	default: // containerArray
+		pos := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+		if pos >= len(c.array) || c.array[pos] != low {
+			return false
+		}
+		c.array = append(c.array[:pos], c.array[pos+1:]...)
+		c.shadow = append(c.shadow[:pos], c.shadow[pos+1:]...)
+		return true
+	}
+}
+
+// release returns any pooled buffer the container holds back to
+// bytepool. Callers must not use the container afterward.
+func (c *offsetContainer) release() {
+	if c.kind == containerBitmap && c.dense != nil {
+		bytepool.Release(c.dense)
+		c.dense = nil
+	}
+}
+
+// runShadowStart returns the offset into c.shadow where the idx-th run's
+// bytes begin.
+func (c *offsetContainer) runShadowStart(idx int) int {
+	n := 0
+	for i := 0; i < idx; i++ {
+		n += int(c.runs[i].length)
+	}
+	return n
+}
+
+func popcount(v uint64) int {
+	n := 0
+	for v != 0 {
+		v &= v - 1
+		n++
+	}
+	return n
+}
+
+func containerKey(offset int64) int64 {
+	return offset >> containerBits
+}
+
+func containerLow(offset int64) uint16 {
+	return uint16(offset & (containerSize - 1))
+}
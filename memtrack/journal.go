@@ -0,0 +1,205 @@
+package memtrack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// TxID identifies a transaction opened with BeginTx. The zero value is
+// never issued by BeginTx, so it's safe as a "no transaction" sentinel.
+type TxID int64
+
+// journalRecord is one append-only entry in a transaction's undo log: tx
+// wrote newValue to offset, having found oldValue there beforehand.
+type journalRecord struct {
+	tx       TxID
+	offset   int64
+	oldValue byte
+	newValue byte
+}
+
+// BeginTx opens a new transaction and returns its TxID. Writes made
+// through ModifyBytesTx under that ID can be undone in one call to
+// Rollback, independent of the tracker's whole-buffer
+// RemoveMemoryAddress undo.
+func (o *OffsetMemoryAddressing) BeginTx() TxID {
+	if o.openTx == nil {
+		o.openTx = make(map[TxID]bool)
+		o.touched = make(map[TxID]map[int64]bool)
+		o.firstTouch = make(map[TxID][]int64)
+	}
+	o.nextTx++
+	tx := o.nextTx
+	o.openTx[tx] = true
+	o.touched[tx] = make(map[int64]bool)
+	return tx
+}
+
+// ModifyBytesTx behaves like ModifyBytes, except the change is also
+// appended to tx's entry in the journal, so a later Rollback(tx, mem)
+// can undo it.
+func (o *OffsetMemoryAddressing) ModifyBytesTx(tx TxID, mem []byte, offset int64, newValue byte) error {
+	if !o.openTx[tx] {
+		return fmt.Errorf("transaction %d is not open", tx)
+	}
+	if offset < 0 || offset >= int64(len(mem)) {
+		return fmt.Errorf("offset %d is out of bounds", offset)
+	}
+
+	o.log = append(o.log, journalRecord{tx: tx, offset: offset, oldValue: mem[offset], newValue: newValue})
+	if !o.touched[tx][offset] {
+		o.touched[tx][offset] = true
+		o.firstTouch[tx] = append(o.firstTouch[tx], offset)
+	}
+
+	return o.ModifyBytes(mem, offset, newValue)
+}
+
+// JournalLen returns the number of records currently in the journal,
+// committed, rolled back, or still open.
+func (o *OffsetMemoryAddressing) JournalLen() int {
+	return len(o.log)
+}
+
+// Commit closes tx without undoing any of its writes. Its journal
+// entries stay in the log, so a later Checkpoint still captures them;
+// Commit itself never trims the log, so it keeps growing across the
+// tracker's lifetime unless the caller calls Compact. That's a
+// deliberate trade-off, not an oversight: Commit doesn't know whether
+// the caller still wants a Checkpoint covering this transaction.
+func (o *OffsetMemoryAddressing) Commit(tx TxID) error {
+	if !o.openTx[tx] {
+		return fmt.Errorf("transaction %d is not open", tx)
+	}
+	delete(o.openTx, tx)
+	return nil
+}
+
+// Rollback undoes every write tx made to mem, walking the journal in
+// reverse so that interleaved writes to the same offset unwind in the
+// right order, then closes tx.
+func (o *OffsetMemoryAddressing) Rollback(tx TxID, mem []byte) error {
+	if !o.openTx[tx] {
+		return fmt.Errorf("transaction %d is not open", tx)
+	}
+	for i := len(o.log) - 1; i >= 0; i-- {
+		record := o.log[i]
+		if record.tx != tx {
+			continue
+		}
+		if record.offset < 0 || record.offset >= int64(len(mem)) {
+			return fmt.Errorf("offset %d is out of bounds", record.offset)
+		}
+		mem[record.offset] = record.oldValue
+	}
+	delete(o.openTx, tx)
+	return nil
+}
+
+// Compact drops journal entries belonging to transactions that are no
+// longer open (already Commit'd or Rollback'd), bounding the log's
+// growth the same way maxUndo bounds the container store's undo depth.
+// It's opt-in rather than automatic on Commit, since a caller that still
+// wants a Checkpoint covering a closed transaction must take it before
+// compacting; calling Compact discards that history for good.
+func (o *OffsetMemoryAddressing) Compact() {
+	if len(o.openTx) == 0 {
+		o.log = nil
+		return
+	}
+	kept := o.log[:0]
+	for _, record := range o.log {
+		if o.openTx[record.tx] {
+			kept = append(kept, record)
+		}
+	}
+	o.log = kept
+}
+
+// journalFrameSize is the fixed payload size of one journal record: an
+// 8-byte TxID, an 8-byte offset, and the old/new byte values.
+const journalFrameSize = 8 + 8 + 1 + 1
+
+// Checkpoint writes every journal record accumulated so far (committed,
+// rolled back, or still open) as a stream of length-prefixed,
+// CRC-32-checked frames, so a checkpoint truncated by a partial write is
+// detectable instead of silently corrupting the next Restore.
+func (o *OffsetMemoryAddressing) Checkpoint(w io.Writer) error {
+	for _, record := range o.log {
+		var payload [journalFrameSize]byte
+		binary.BigEndian.PutUint64(payload[0:8], uint64(record.tx))
+		binary.BigEndian.PutUint64(payload[8:16], uint64(record.offset))
+		payload[16] = record.oldValue
+		payload[17] = record.newValue
+		if err := writeFrame(w, payload[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore replaces o's journal with the frame stream read from r until
+// EOF. It only reconstructs the append-only log, not open-transaction
+// bookkeeping: frames are assumed to describe already-closed history.
+func (o *OffsetMemoryAddressing) Restore(r io.Reader) error {
+	var log []journalRecord
+	for {
+		payload, err := readFrame(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		log = append(log, journalRecord{
+			tx:       TxID(binary.BigEndian.Uint64(payload[0:8])),
+			offset:   int64(binary.BigEndian.Uint64(payload[8:16])),
+			oldValue: payload[16],
+			newValue: payload[17],
+		})
+	}
+	o.log = log
+	return nil
+}
+
+// writeFrame writes payload as [4-byte length][payload][4-byte CRC32 of
+// payload]. It backs both the journal's Checkpoint and the container
+// store's Serialize.
+func writeFrame(w io.Writer, payload []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	var trailer [4]byte
+	binary.BigEndian.PutUint32(trailer[:], crc32.ChecksumIEEE(payload))
+	_, err := w.Write(trailer[:])
+	return err
+}
+
+// readFrame reads one frame written by writeFrame. It returns io.EOF
+// only when the stream ends exactly on a frame boundary.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("memtrack: truncated frame: %w", err)
+	}
+	var trailer [4]byte
+	if _, err := io.ReadFull(r, trailer[:]); err != nil {
+		return nil, fmt.Errorf("memtrack: truncated frame checksum: %w", err)
+	}
+	if want := binary.BigEndian.Uint32(trailer[:]); crc32.ChecksumIEEE(payload) != want {
+		return nil, fmt.Errorf("memtrack: frame checksum mismatch, data is corrupt or was partially written")
+	}
+	return payload, nil
+}
@@ -0,0 +1,51 @@
+package memtrack
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// offsetFrameSize is the fixed payload size of one serialized offset: an
+// 8-byte offset and its shadowed original byte.
+const offsetFrameSize = 8 + 1
+
+// Serialize writes every tracked (offset, originalByte) pair as a stream
+// of length-prefixed, CRC-32-checked frames, the same framing Checkpoint
+// uses for the journal. Unlike Checkpoint, this captures the container
+// store itself, so a tracker can be rebuilt without replaying every
+// ModifyBytes call that produced it.
+func (o *OffsetMemoryAddressing) Serialize(w io.Writer) error {
+	var writeErr error
+	o.Iterate(func(offset int64, originalByte byte) bool {
+		var payload [offsetFrameSize]byte
+		binary.BigEndian.PutUint64(payload[0:8], uint64(offset))
+		payload[8] = originalByte
+		if err := writeFrame(w, payload[:]); err != nil {
+			writeErr = err
+			return false
+		}
+		return true
+	})
+	return writeErr
+}
+
+// Deserialize replaces o's tracked offsets with the frame stream read
+// from r until EOF, as written by Serialize. It does not touch any
+// backing mem buffer or the transactional journal; o.track only records
+// the offset as dirty with the given shadow byte.
+func (o *OffsetMemoryAddressing) Deserialize(r io.Reader) error {
+	containers := make(map[int64]*offsetContainer)
+	o.containers = containers
+	for {
+		payload, err := readFrame(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset := int64(binary.BigEndian.Uint64(payload[0:8]))
+		o.track(offset, payload[8])
+	}
+	return nil
+}
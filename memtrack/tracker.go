@@ -0,0 +1,250 @@
+package memtrack
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+)
+
+// OffsetMemoryAddressing tracks byte changes at specific memory offsets
+// using a roaring-bitmap-style hybrid store: offsets are partitioned
+// into 16-bit containers, each of which picks the cheapest of array,
+// bitmap, or run-length representation for its current cardinality, with
+// a parallel packed byte array of shadowed original bytes. For a 4K RGBA
+// frame (~32 MB of tracked offsets) this uses megabytes instead of the
+// gigabytes a flat map costs.
+//
+// When maxUndo is non-zero, the tracker keeps at most maxUndo undo
+// records: ModifyBytes evicts the oldest tracked offset once that bound
+// is exceeded, so tracking changes across a buffer far larger than
+// available memory (e.g. an mmap'd 100 MP image) still runs in bounded
+// space.
+type OffsetMemoryAddressing struct {
+	containers map[int64]*offsetContainer
+	maxUndo    int
+	order      *list.List
+	elems      map[int64]*list.Element
+
+	// Transactional journal (see BeginTx): log is an append-only record
+	// of every write made through ModifyBytesTx, openTx tracks which
+	// TxIDs haven't been Commit/Rollback'd yet, and firstTouch/touched
+	// index the offsets each transaction wrote to for the first time.
+	//
+	// log keeps growing even after a transaction closes, since Checkpoint
+	// needs to see committed history and Rollback needs it for whichever
+	// transaction is still open; nothing here bounds it the way maxUndo
+	// bounds the container store above. A caller running many short-lived
+	// transactions over a long process lifetime should call Compact
+	// periodically (after any Checkpoint it still needs) to drop records
+	// for transactions that have already closed.
+	nextTx     TxID
+	log        []journalRecord
+	openTx     map[TxID]bool
+	touched    map[TxID]map[int64]bool
+	firstTouch map[TxID][]int64
+}
+
+// New builds a tracker with no undo bound: it never evicts a tracked
+// offset on its own, so RemoveMemoryAddress can always restore every
+// byte it ever modified.
+func New() *OffsetMemoryAddressing {
+	return &OffsetMemoryAddressing{containers: make(map[int64]*offsetContainer)}
+}
+
+// NewBounded builds a tracker that keeps at most maxUndo undo records,
+// evicting the oldest once the bound is exceeded.
+func NewBounded(maxUndo int) *OffsetMemoryAddressing {
+	return &OffsetMemoryAddressing{
+		containers: make(map[int64]*offsetContainer),
+		maxUndo:    maxUndo,
+		order:      list.New(),
+		elems:      make(map[int64]*list.Element),
+	}
+}
+
+// evictOldest drops the least-recently-tracked offset once the tracker
+// is over its maxUndo bound. The corresponding byte simply can no longer
+// be restored; that's the space/undo-depth trade-off a bounded log
+// makes.
+func (o *OffsetMemoryAddressing) evictOldest() {
+	oldest := o.order.Front()
+	if oldest == nil {
+		return
+	}
+	offset := oldest.Value.(int64)
+	o.order.Remove(oldest)
+	delete(o.elems, offset)
+
+	key := containerKey(offset)
+	if container, ok := o.containers[key]; ok {
+		container.remove(containerLow(offset))
+		if container.cardinality() == 0 {
+			container.release()
+			delete(o.containers, key)
+		}
+	}
+}
+
+// RemoveMemoryAddress restores every tracked offset in mem to its
+// shadowed original byte, then forgets all tracked state.
+func (o *OffsetMemoryAddressing) RemoveMemoryAddress(mem []byte) error {
+	if len(mem) == 0 {
+		return fmt.Errorf("mem block is empty")
+	}
+
+	var outOfBounds error
+	for key, container := range o.containers {
+		base := key << containerBits
+		container.iterate(func(low uint16, originalByte byte) bool {
+			offset := base + int64(low)
+			if offset < 0 || offset >= int64(len(mem)) {
+				outOfBounds = fmt.Errorf("offset %d is out of bounds", offset)
+				return false
+			}
+			mem[offset] = originalByte
+			return true
+		})
+		if outOfBounds != nil {
+			return outOfBounds
+		}
+	}
+
+	for _, container := range o.containers {
+		container.release()
+	}
+	o.containers = make(map[int64]*offsetContainer)
+	if o.maxUndo > 0 {
+		o.order = list.New()
+		o.elems = make(map[int64]*list.Element)
+	}
+	return nil
+}
+
+// ModifyBytes writes newValue to mem at offset, shadowing the byte
+// previously there the first time offset is touched.
+func (o *OffsetMemoryAddressing) ModifyBytes(mem []byte, offset int64, newValue byte) error {
+	if offset < 0 || offset >= int64(len(mem)) {
+		return fmt.Errorf("offset %d is out of bounds", offset)
+	}
+
+	key := containerKey(offset)
+	container, exists := o.containers[key]
+	if !exists {
+		container = newOffsetContainer()
+		o.containers[key] = container
+	}
+
+	// Store original byte if not already tracked
+	if container.insert(containerLow(offset), mem[offset]) && o.maxUndo > 0 {
+		o.elems[offset] = o.order.PushBack(offset)
+		if o.order.Len() > o.maxUndo {
+			o.evictOldest()
+		}
+	}
+
+	// Apply modification
+	mem[offset] = newValue
+	return nil
+}
+
+// Iterate walks every tracked (offset, originalByte) pair in ascending
+// offset order, stopping early if fn returns false.
+func (o *OffsetMemoryAddressing) Iterate(fn func(offset int64, originalByte byte) bool) {
+	keys := make([]int64, 0, len(o.containers))
+	for key := range o.containers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, key := range keys {
+		base := key << containerBits
+		stop := false
+		o.containers[key].iterate(func(low uint16, originalByte byte) bool {
+			if !fn(base+int64(low), originalByte) {
+				stop = true
+				return false
+			}
+			return true
+		})
+		if stop {
+			return
+		}
+	}
+}
+
+// Union returns a new tracker containing every offset dirty in either o
+// or other. Where both track the same offset, o's shadowed byte wins.
+func (o *OffsetMemoryAddressing) Union(other *OffsetMemoryAddressing) *OffsetMemoryAddressing {
+	result := New()
+	o.Iterate(func(offset int64, originalByte byte) bool {
+		result.track(offset, originalByte)
+		return true
+	})
+	other.Iterate(func(offset int64, originalByte byte) bool {
+		result.track(offset, originalByte)
+		return true
+	})
+	return result
+}
+
+// Intersect returns a new tracker containing only the offsets dirty in
+// both o and other, shadowed with o's original bytes.
+func (o *OffsetMemoryAddressing) Intersect(other *OffsetMemoryAddressing) *OffsetMemoryAddressing {
+	result := New()
+	o.Iterate(func(offset int64, originalByte byte) bool {
+		key := containerKey(offset)
+		if container, ok := other.containers[key]; ok {
+			if _, ok := container.get(containerLow(offset)); ok {
+				result.track(offset, originalByte)
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// Diff returns a new tracker containing the offsets dirty in o but not
+// in other.
+func (o *OffsetMemoryAddressing) Diff(other *OffsetMemoryAddressing) *OffsetMemoryAddressing {
+	result := New()
+	o.Iterate(func(offset int64, originalByte byte) bool {
+		key := containerKey(offset)
+		if container, ok := other.containers[key]; ok {
+			if _, ok := container.get(containerLow(offset)); ok {
+				return true
+			}
+		}
+		result.track(offset, originalByte)
+		return true
+	})
+	return result
+}
+
+// Cardinality returns the total number of offsets currently tracked.
+func (o *OffsetMemoryAddressing) Cardinality() int {
+	n := 0
+	for _, container := range o.containers {
+		n += container.cardinality()
+	}
+	return n
+}
+
+// ContainerCount returns the number of 16-bit containers currently
+// holding at least one tracked offset, mainly useful for diagnostics:
+// unlike Cardinality, it reflects bookkeeping overhead rather than the
+// number of dirty bytes.
+func (o *OffsetMemoryAddressing) ContainerCount() int {
+	return len(o.containers)
+}
+
+// track unconditionally records offset as dirty with the given shadow
+// byte, without touching mem; it backs Union/Intersect/Diff.
+func (o *OffsetMemoryAddressing) track(offset int64, originalByte byte) {
+	key := containerKey(offset)
+	container, exists := o.containers[key]
+	if !exists {
+		container = newOffsetContainer()
+		o.containers[key] = container
+	}
+	container.insert(containerLow(offset), originalByte)
+}
@@ -0,0 +1,184 @@
+package memtrack
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestModifyBytesAndRemoveMemoryAddress(t *testing.T) {
+	data := []byte{0x10, 0x20, 0x30, 0x40, 0x50}
+	tracker := New()
+
+	if err := tracker.ModifyBytes(data, 1, 0x99); err != nil {
+		t.Fatalf("ModifyBytes: %v", err)
+	}
+	if err := tracker.ModifyBytes(data, 3, 0x77); err != nil {
+		t.Fatalf("ModifyBytes: %v", err)
+	}
+	if want := []byte{0x10, 0x99, 0x30, 0x77, 0x50}; !bytes.Equal(data, want) {
+		t.Fatalf("after modification: got % x, want % x", data, want)
+	}
+	if got, want := tracker.Cardinality(), 2; got != want {
+		t.Fatalf("Cardinality() = %d, want %d", got, want)
+	}
+
+	if err := tracker.RemoveMemoryAddress(data); err != nil {
+		t.Fatalf("RemoveMemoryAddress: %v", err)
+	}
+	if want := []byte{0x10, 0x20, 0x30, 0x40, 0x50}; !bytes.Equal(data, want) {
+		t.Fatalf("after restoration: got % x, want % x", data, want)
+	}
+	if got, want := tracker.ContainerCount(), 0; got != want {
+		t.Fatalf("ContainerCount() = %d, want %d", got, want)
+	}
+}
+
+func TestBoundedEvictsOldest(t *testing.T) {
+	data := make([]byte, 4)
+	tracker := NewBounded(2)
+
+	for i := int64(0); i < 4; i++ {
+		if err := tracker.ModifyBytes(data, i, byte(i)+1); err != nil {
+			t.Fatalf("ModifyBytes(%d): %v", i, err)
+		}
+	}
+	if got, want := tracker.Cardinality(), 2; got != want {
+		t.Fatalf("Cardinality() = %d, want %d (oldest two offsets should have been evicted)", got, want)
+	}
+}
+
+func TestUnionIntersectDiff(t *testing.T) {
+	a, b := New(), New()
+	a.track(0, 0xAA)
+	a.track(1, 0xBB)
+	b.track(1, 0xCC)
+	b.track(2, 0xDD)
+
+	union := a.Union(b)
+	if got, want := union.Cardinality(), 3; got != want {
+		t.Fatalf("Union cardinality = %d, want %d", got, want)
+	}
+
+	intersect := a.Intersect(b)
+	if got, want := intersect.Cardinality(), 1; got != want {
+		t.Fatalf("Intersect cardinality = %d, want %d", got, want)
+	}
+	if v, ok := intersect.containers[containerKey(1)].get(containerLow(1)); !ok || v != 0xBB {
+		t.Fatalf("Intersect kept wrong shadow byte for offset 1: got (%v, %v)", v, ok)
+	}
+
+	diff := a.Diff(b)
+	if got, want := diff.Cardinality(), 1; got != want {
+		t.Fatalf("Diff cardinality = %d, want %d", got, want)
+	}
+	if _, ok := diff.containers[containerKey(0)]; !ok {
+		t.Fatalf("Diff should still track offset 0, the one only a tracked")
+	}
+}
+
+func TestTransactionCommitAndRollback(t *testing.T) {
+	data := []byte{0x10, 0x20, 0x30}
+	tracker := New()
+
+	speculative := tracker.BeginTx()
+	if err := tracker.ModifyBytesTx(speculative, data, 0, 0xAA); err != nil {
+		t.Fatalf("ModifyBytesTx: %v", err)
+	}
+	if err := tracker.Rollback(speculative, data); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if data[0] != 0x10 {
+		t.Fatalf("after Rollback: data[0] = 0x%02x, want 0x10", data[0])
+	}
+
+	committed := tracker.BeginTx()
+	if err := tracker.ModifyBytesTx(committed, data, 0, 0xBB); err != nil {
+		t.Fatalf("ModifyBytesTx: %v", err)
+	}
+	if err := tracker.Commit(committed); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if data[0] != 0xBB {
+		t.Fatalf("after Commit: data[0] = 0x%02x, want 0xBB", data[0])
+	}
+	if got, want := tracker.JournalLen(), 2; got != want {
+		t.Fatalf("JournalLen() = %d, want %d", got, want)
+	}
+}
+
+func TestCompactDropsClosedTransactions(t *testing.T) {
+	data := []byte{0x10, 0x20}
+	tracker := New()
+
+	closed := tracker.BeginTx()
+	tracker.ModifyBytesTx(closed, data, 0, 0xAA)
+	tracker.Commit(closed)
+
+	open := tracker.BeginTx()
+	tracker.ModifyBytesTx(open, data, 1, 0xBB)
+
+	if got, want := tracker.JournalLen(), 2; got != want {
+		t.Fatalf("JournalLen() before Compact = %d, want %d", got, want)
+	}
+
+	tracker.Compact()
+	if got, want := tracker.JournalLen(), 1; got != want {
+		t.Fatalf("JournalLen() after Compact = %d, want %d (only the open transaction's record should remain)", got, want)
+	}
+
+	if err := tracker.Rollback(open, data); err != nil {
+		t.Fatalf("Rollback after Compact: %v", err)
+	}
+	if data[1] != 0x20 {
+		t.Fatalf("after Rollback: data[1] = 0x%02x, want 0x20", data[1])
+	}
+}
+
+func TestCheckpointRestoreRoundTrip(t *testing.T) {
+	data := []byte{0x10, 0x20}
+	tracker := New()
+	tx := tracker.BeginTx()
+	tracker.ModifyBytesTx(tx, data, 0, 0xAA)
+	tracker.Commit(tx)
+
+	var buf bytes.Buffer
+	if err := tracker.Checkpoint(&buf); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+
+	restored := New()
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got, want := restored.JournalLen(), tracker.JournalLen(); got != want {
+		t.Fatalf("JournalLen() after Restore = %d, want %d", got, want)
+	}
+}
+
+func TestSerializeDeserializeRoundTrip(t *testing.T) {
+	data := []byte{0x10, 0x20, 0x30, 0x40, 0x50}
+	tracker := New()
+	tracker.ModifyBytes(data, 1, 0x99)
+	tracker.ModifyBytes(data, 3, 0x77)
+
+	var buf bytes.Buffer
+	if err := tracker.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+
+	restored := New()
+	if err := restored.Deserialize(&buf); err != nil {
+		t.Fatalf("Deserialize: %v", err)
+	}
+	if got, want := restored.Cardinality(), tracker.Cardinality(); got != want {
+		t.Fatalf("Cardinality() after Deserialize = %d, want %d", got, want)
+	}
+
+	restoredData := append([]byte(nil), data...)
+	if err := restored.RemoveMemoryAddress(restoredData); err != nil {
+		t.Fatalf("RemoveMemoryAddress: %v", err)
+	}
+	if want := []byte{0x10, 0x20, 0x30, 0x40, 0x50}; !bytes.Equal(restoredData, want) {
+		t.Fatalf("restored tracker produced % x, want % x", restoredData, want)
+	}
+}
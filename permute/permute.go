@@ -0,0 +1,249 @@
+// Package permute provides reversible index permutations for shuffling
+// and restoring image pixel data, plus helpers for applying a
+// permutation across two images without materializing a full index
+// slice for the inverse direction.
+package permute
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/draw"
+	"math/bits"
+	"math/rand"
+)
+
+// Permutation maps indices in [0, Len()) to other indices in the same
+// range, and can compute the inverse mapping for any index.
+type Permutation interface {
+	// Len reports the size of the domain this permutation operates over.
+	Len() int
+	// At returns the index that i maps to.
+	At(i int) int
+	// Invert returns the index that maps to i, i.e. the j such that
+	// At(j) == i.
+	Invert(i int) int
+}
+
+// FisherYates is a Permutation built by shuffling [0, n) with a
+// deterministic PRNG stream, the same algorithm main's original
+// hand-rolled shuffle used. Forward and inverse mappings are both
+// materialized up front.
+type FisherYates struct {
+	forward []int
+	inverse []int
+}
+
+// NewFisherYates builds a Fisher-Yates shuffle of [0, n) seeded with
+// seed, so the same seed always reproduces the same permutation.
+func NewFisherYates(seed int64, n int) *FisherYates {
+	src := rand.New(rand.NewSource(seed))
+	forward := make([]int, n)
+	for i := range forward {
+		forward[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j := src.Intn(i + 1)
+		forward[i], forward[j] = forward[j], forward[i]
+	}
+
+	inverse := make([]int, n)
+	for i, v := range forward {
+		inverse[v] = i
+	}
+
+	return &FisherYates{forward: forward, inverse: inverse}
+}
+
+func (p *FisherYates) Len() int         { return len(p.forward) }
+func (p *FisherYates) At(i int) int     { return p.forward[i] }
+func (p *FisherYates) Invert(i int) int { return p.inverse[i] }
+
+// Feistel is a keyed, format-preserving Permutation over [0, n) built
+// from a balanced Feistel network with cycle-walking: the network
+// operates over the smallest power of two at or above n whose bit count
+// is even, so both halves have the same width (for n = 100 that is 256,
+// not 128), and any output that lands outside [0, n) is fed back
+// through the network until it lands inside it. Unlike FisherYates, both At and Invert are O(rounds)
+// per call and need no materialized index slice.
+type Feistel struct {
+	key      []byte
+	rounds   int
+	n        int
+	halfBits uint
+	halfMask uint64
+}
+
+// NewFeistel builds a Feistel permutation over [0, n) keyed by key,
+// running rounds Feistel rounds per step. More rounds mix the domain
+// more thoroughly at the cost of more hashing per At/Invert call.
+func NewFeistel(key []byte, rounds, n int) *Feistel {
+	domainBits := bits.Len(uint(n - 1))
+	if domainBits%2 != 0 {
+		domainBits++
+	}
+	halfBits := uint(domainBits / 2)
+
+	return &Feistel{
+		key:      key,
+		rounds:   rounds,
+		n:        n,
+		halfBits: halfBits,
+		halfMask: (1 << halfBits) - 1,
+	}
+}
+
+func (p *Feistel) Len() int { return p.n }
+
+func (p *Feistel) At(i int) int {
+	x := uint64(i)
+	for {
+		x = p.round(x, forward)
+		if x < uint64(p.n) {
+			return int(x)
+		}
+	}
+}
+
+func (p *Feistel) Invert(i int) int {
+	x := uint64(i)
+	for {
+		x = p.round(x, backward)
+		if x < uint64(p.n) {
+			return int(x)
+		}
+	}
+}
+
+type direction bool
+
+const (
+	forward  direction = true
+	backward direction = false
+)
+
+// round runs the full Feistel network once over x, forward or backward.
+// Forward applies L,R = R, L XOR F(key, round, R) for each round in
+// order; backward undoes that by running the same step in reverse
+// round order, which is what makes the network invertible without
+// storing anything beyond the key.
+func (p *Feistel) round(x uint64, dir direction) uint64 {
+	l, r := x>>p.halfBits, x&p.halfMask
+
+	if dir == forward {
+		for round := 0; round < p.rounds; round++ {
+			l, r = r, l^p.f(round, r)
+		}
+	} else {
+		for round := p.rounds - 1; round >= 0; round-- {
+			l, r = r^p.f(round, l), l
+		}
+	}
+
+	return (l << p.halfBits) | r
+}
+
+// f is the Feistel round function: a keyed hash of the round number and
+// the current half, truncated to halfBits.
+func (p *Feistel) f(round int, half uint64) uint64 {
+	h := fnv.New64a()
+	h.Write(p.key)
+
+	var buf [12]byte
+	binary.BigEndian.PutUint32(buf[0:4], uint32(round))
+	binary.BigEndian.PutUint64(buf[4:12], half)
+	h.Write(buf[:])
+
+	return h.Sum64() & p.halfMask
+}
+
+// Block wraps an inner Permutation defined over block indices so that
+// every pixel within a blockSize x blockSize block (e.g. a JPEG 8x8 DCT
+// block) moves together, keeping each block's internal structure
+// intact. width and height MUST be exact multiples of blockSize: a
+// partial edge block would place some of its pixels at block-aligned
+// offsets that don't exist in the grid (e.g. a full interior block
+// permuted into a partial edge block's position), producing indices
+// outside [0, Len()) from At/Invert. NewBlock rejects anything else
+// rather than silently producing a broken Permutation.
+type Block struct {
+	width, height int
+	blockSize     int
+	blocksWide    int
+	inner         Permutation
+}
+
+// NewBlock builds a block-wise Permutation over a width x height grid,
+// using inner (sized (width/blockSize)*(height/blockSize)) to permute
+// whole blockSize x blockSize blocks. It returns an error if width or
+// height isn't an exact multiple of blockSize; see the Block doc comment
+// for why partial edge blocks aren't supported.
+func NewBlock(width, height, blockSize int, inner Permutation) (*Block, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("permute: blockSize %d must be positive", blockSize)
+	}
+	if width%blockSize != 0 || height%blockSize != 0 {
+		return nil, fmt.Errorf("permute: width %d and height %d must both be exact multiples of blockSize %d", width, height, blockSize)
+	}
+	return &Block{
+		width:      width,
+		height:     height,
+		blockSize:  blockSize,
+		blocksWide: width / blockSize,
+		inner:      inner,
+	}, nil
+}
+
+func (p *Block) Len() int { return p.width * p.height }
+
+func (p *Block) At(i int) int {
+	return p.mapThrough(i, p.inner.At)
+}
+
+func (p *Block) Invert(i int) int {
+	return p.mapThrough(i, p.inner.Invert)
+}
+
+func (p *Block) mapThrough(i int, blockMap func(int) int) int {
+	x, y := i%p.width, i/p.width
+	ox, oy := x%p.blockSize, y%p.blockSize
+	bx, by := x/p.blockSize, y/p.blockSize
+
+	newBlock := blockMap(by*p.blocksWide + bx)
+	newBx, newBy := newBlock%p.blocksWide, newBlock/p.blocksWide
+
+	newX := newBx*p.blockSize + ox
+	newY := newBy*p.blockSize + oy
+	return newY*p.width + newX
+}
+
+// Apply copies every pixel of src to its permuted position in dst:
+// dst pixel At(i) receives src pixel i, for every i in [0, p.Len()).
+// src and dst must both have p.Len() == width*height pixels.
+func Apply(src image.Image, dst draw.Image, p Permutation) error {
+	return walk(src, dst, p.Len(), p.At)
+}
+
+// Invert undoes Apply: it rebuilds the original layout from src (which
+// holds the permuted pixels) into dst, using only p.Invert so the
+// caller never needs to store the forward mapping.
+func Invert(src image.Image, dst draw.Image, p Permutation) error {
+	return walk(src, dst, p.Len(), p.Invert)
+}
+
+func walk(src image.Image, dst draw.Image, n int, mapIndex func(int) int) error {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width*height != n {
+		return fmt.Errorf("permute: src has %d pixels, permutation covers %d", width*height, n)
+	}
+
+	for i := 0; i < n; i++ {
+		srcX, srcY := bounds.Min.X+i%width, bounds.Min.Y+i/width
+		j := mapIndex(i)
+		dstX, dstY := bounds.Min.X+j%width, bounds.Min.Y+j/width
+		dst.Set(dstX, dstY, src.At(srcX, srcY))
+	}
+	return nil
+}